@@ -0,0 +1,171 @@
+/*
+ * This file is part of YukkiMusic.
+ *
+ * YukkiMusic — A Telegram bot that streams music into group voice chats with seamless playback and control.
+ * Copyright (C) 2025 TheTeamVivek
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package ippool hands out local source IPs to outgoing HTTP clients so
+// download platforms can stripe requests across several interfaces instead
+// of hammering a rate-limited API from a single address. Modeled on ytsync's
+// ip_manager.IPPool.
+package ippool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Laky-64/gologging"
+)
+
+// ErrNoIPAvailable is returned by Get when every configured IP is either
+// cooling down or throttled.
+var ErrNoIPAvailable = errors.New("ippool: no source ip available")
+
+const (
+	// DefaultCooldown is applied to an IP after every use.
+	DefaultCooldown = 30 * time.Second
+	// DefaultThrottlePenalty is applied to an IP after ReportThrottle.
+	DefaultThrottlePenalty = 10 * time.Minute
+)
+
+// entry tracks per-IP usage state.
+type entry struct {
+	addr      *net.TCPAddr
+	inUse     bool
+	lastUsed  time.Time
+	blockedAt time.Time
+}
+
+// Pool hands out local interface IPs on a least-recently-used basis and
+// tracks per-IP cooldowns and throttle penalties. A nil or empty Pool is
+// valid and Get always returns ErrNoIPAvailable, which callers should treat
+// as "fall back to default behavior".
+type Pool struct {
+	mu              sync.Mutex
+	entries         []*entry
+	cooldown        time.Duration
+	throttlePenalty time.Duration
+}
+
+// New builds a Pool from a list of local IPs (as configured via
+// DownloadSourceIPs). Invalid addresses are skipped with a warning. An empty
+// or all-invalid list yields a disabled pool.
+func New(ips []string, cooldown, throttlePenalty time.Duration) *Pool {
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	if throttlePenalty <= 0 {
+		throttlePenalty = DefaultThrottlePenalty
+	}
+
+	p := &Pool{
+		cooldown:        cooldown,
+		throttlePenalty: throttlePenalty,
+	}
+
+	for _, raw := range ips {
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			gologging.WarnF("ippool: ignoring invalid source ip %q", raw)
+			continue
+		}
+		p.entries = append(p.entries, &entry{addr: &net.TCPAddr{IP: ip}})
+	}
+
+	return p
+}
+
+// Enabled reports whether the pool has at least one usable IP configured.
+func (p *Pool) Enabled() bool {
+	return p != nil && len(p.entries) > 0
+}
+
+// Get returns the least-recently-used IP that isn't currently cooling down,
+// throttled, or already checked out, along with a release func the caller
+// must invoke once the request is done. Callers should fall back to default
+// (no bound local address) behavior when err is non-nil.
+func (p *Pool) Get(ctx context.Context) (*net.TCPAddr, func(), error) {
+	if !p.Enabled() {
+		return nil, nil, ErrNoIPAvailable
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	var best *entry
+	for _, e := range p.entries {
+		if e.inUse {
+			continue
+		}
+		if now.Sub(e.blockedAt) < p.throttlePenalty {
+			continue
+		}
+		if now.Sub(e.lastUsed) < p.cooldown {
+			continue
+		}
+		if best == nil || e.lastUsed.Before(best.lastUsed) {
+			best = e
+		}
+	}
+
+	if best == nil {
+		return nil, nil, ErrNoIPAvailable
+	}
+
+	best.inUse = true
+	var released bool
+	release := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if released {
+			return
+		}
+		released = true
+		best.inUse = false
+		best.lastUsed = time.Now()
+	}
+
+	return best.addr, release, nil
+}
+
+// ReportThrottle marks the IP as throttled, keeping it out of rotation for
+// the configured throttle penalty. Callers should invoke this when a
+// download API responds with 429 or 403 for a request made from ip.
+func (p *Pool) ReportThrottle(ip *net.TCPAddr) {
+	if !p.Enabled() || ip == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range p.entries {
+		if e.addr.IP.Equal(ip.IP) {
+			e.blockedAt = time.Now()
+			gologging.WarnF("ippool: %s throttled, sitting out for %s", ip.IP, p.throttlePenalty)
+			return
+		}
+	}
+}
@@ -0,0 +1,528 @@
+/*
+ * This file is part of YukkiMusic.
+ *
+ * YukkiMusic — A Telegram bot that streams music into group voice chats with seamless playback and control.
+ * Copyright (C) 2025 TheTeamVivek
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package platforms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafov/m3u8"
+
+	"github.com/Laky-64/gologging"
+	"github.com/amarnathcjd/gogram/telegram"
+
+	state "main/internal/core/models"
+)
+
+const PlatformHLS state.PlatformName = "HLS"
+
+// DefaultHLSConcurrency bounds simultaneous segment fetches when
+// state.Config.HLSConcurrency is unset.
+const DefaultHLSConcurrency = 4
+
+// MaxHLSDuration bounds how long we keep pulling segments from a live
+// (no EXT-X-ENDLIST) playlist before giving up.
+const MaxHLSDuration = 10 * time.Minute
+
+// hlsDefaultPollInterval is used to re-fetch a live playlist when it
+// doesn't advertise its own EXT-X-TARGETDURATION.
+const hlsDefaultPollInterval = 6 * time.Second
+
+// HLSPlatform downloads .m3u8 manifests segment by segment and remuxes them
+// into a single file with ffmpeg. It exists for radio stations and live
+// music channels that serve HLS instead of a single media file.
+type HLSPlatform struct{}
+
+func init() {
+	Register(60, &HLSPlatform{})
+}
+
+func (h *HLSPlatform) Name() state.PlatformName {
+	return PlatformHLS
+}
+
+// IsValid recognizes HLS manifest URLs directly.
+func (h *HLSPlatform) IsValid(query string) bool {
+	return strings.Contains(query, ".m3u8")
+}
+
+// GetTracks - HLS is a download-only platform; IsValid gates it to manifest
+// URLs, which Download handles directly via track.ID.
+func (h *HLSPlatform) GetTracks(query string) ([]*state.Track, error) {
+	return nil, errors.New("hls is a download-only platform")
+}
+
+// IsDownloadSupported - HLS only ever serves itself; it isn't a fallback
+// target for other platforms' IDs.
+func (h *HLSPlatform) IsDownloadSupported(source state.PlatformName) bool {
+	return source == PlatformHLS
+}
+
+// Download fetches the manifest at track.ID, resolves the best variant,
+// downloads every segment concurrently, and remuxes the result with ffmpeg.
+func (h *HLSPlatform) Download(
+	ctx context.Context,
+	track *state.Track,
+	_ *telegram.NewMessage,
+) (string, error) {
+	// A cached file that fails validation (e.g. a truncated download from
+	// before this check existed) is discarded so the rest of Download
+	// re-fetches it instead of serving it forever.
+	if path, err := checkDownloadedFile(track.ID); err == nil {
+		if verr := ValidateMedia(path, track.Video, 0); verr == nil {
+			gologging.InfoF("HLS: Using cached file for %s", track.ID)
+			return path, nil
+		} else {
+			gologging.WarnF("HLS: cached file for %s failed validation, re-downloading: %v", track.ID, verr)
+		}
+	}
+
+	if err := ensureDownloadsDir(); err != nil {
+		return "", fmt.Errorf("failed to create downloads directory: %w", err)
+	}
+
+	mediaURL, err := h.resolveMediaPlaylist(ctx, track.ID, track.Video)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve media playlist: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "hls-"+track.ID+"-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	segmentPaths, err := fetchAllSegments(ctx, tmpDir, mediaURL, track.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to download segments: %w", err)
+	}
+
+	concatPath := filepath.Join(tmpDir, "concat.ts")
+	if err := concatSegments(concatPath, segmentPaths); err != nil {
+		return "", fmt.Errorf("failed to concatenate segments: %w", err)
+	}
+
+	ext := ".mp3"
+	if track.Video {
+		ext = ".mp4"
+	}
+	outPath := filepath.Join("downloads", track.ID+ext)
+
+	if err := remux(ctx, concatPath, outPath); err != nil {
+		return "", fmt.Errorf("failed to remux to %s: %w", ext, err)
+	}
+
+	if err := ValidateMedia(outPath, track.Video, 0); err != nil {
+		return "", fmt.Errorf("downloaded file failed validation: %w", err)
+	}
+
+	gologging.InfoF("HLS: Successfully downloaded %s", track.Title)
+	return outPath, nil
+}
+
+// resolveMediaPlaylist decodes the manifest at manifestURL. When it's a
+// master playlist it picks the highest-bitrate audio-only variant, or the
+// 720p video variant when wantVideo is set, and returns that variant's URL.
+// When it's already a media playlist, manifestURL is returned unchanged.
+func (h *HLSPlatform) resolveMediaPlaylist(ctx context.Context, manifestURL string, wantVideo bool) (string, error) {
+	body, err := fetchURL(ctx, manifestURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	playlist, listType, err := m3u8.DecodeFrom(body, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	if listType != m3u8.MASTER {
+		return manifestURL, nil
+	}
+
+	master := playlist.(*m3u8.MasterPlaylist)
+	if len(master.Variants) == 0 {
+		return "", errors.New("master playlist has no variants")
+	}
+
+	best := master.Variants[0]
+	for _, v := range master.Variants[1:] {
+		if wantVideo {
+			if is720p(v) && !is720p(best) {
+				best = v
+			}
+			continue
+		}
+		if v.Resolution == "" && best.Resolution != "" {
+			best = v
+		}
+		if v.Bandwidth > best.Bandwidth && v.Resolution == "" {
+			best = v
+		}
+	}
+
+	return resolveURL(manifestURL, best.URI), nil
+}
+
+func is720p(v *m3u8.Variant) bool {
+	return strings.Contains(v.Resolution, "720")
+}
+
+func fetchMediaPlaylist(ctx context.Context, mediaURL string) (*m3u8.MediaPlaylist, error) {
+	body, err := fetchURL(ctx, mediaURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	playlist, listType, err := m3u8.DecodeFrom(body, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode media playlist: %w", err)
+	}
+	if listType != m3u8.MEDIA {
+		return nil, errors.New("expected a media playlist")
+	}
+
+	return playlist.(*m3u8.MediaPlaylist), nil
+}
+
+// fetchAllSegments walks the media playlist at mediaURL to completion. For a
+// VOD playlist (EXT-X-ENDLIST present) that's a single fetch. For a live
+// playlist it keeps re-polling the manifest - waiting roughly
+// EXT-X-TARGETDURATION between polls, as the spec requires - pulling in only
+// the segments newer than the last one it already downloaded, until
+// EXT-X-ENDLIST finally appears or MaxHLSDuration worth of segments have
+// actually been downloaded.
+func fetchAllSegments(ctx context.Context, tmpDir, mediaURL, trackID string) ([]string, error) {
+	concurrency := state.Config.HLSConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultHLSConcurrency
+	}
+
+	var (
+		allPaths []string
+		elapsed  time.Duration
+		lastSeq  uint64
+		haveSeq  bool
+		curKey   *m3u8.Key
+	)
+
+	for poll := 0; ; poll++ {
+		playlist, err := fetchMediaPlaylist(ctx, mediaURL)
+		if err != nil {
+			return nil, err
+		}
+
+		if poll == 0 {
+			if playlist.Closed {
+				gologging.InfoF("HLS: %s is VOD, downloading %d segments", trackID, len(playlist.Segments))
+			} else {
+				gologging.InfoF("HLS: %s is a live playlist, capping at %s", trackID, MaxHLSDuration)
+			}
+		}
+
+		var pendingSegs []*m3u8.MediaSegment
+		var pendingKeys []*m3u8.Key
+		for _, seg := range playlist.Segments {
+			if seg == nil {
+				continue
+			}
+			if seg.Key != nil {
+				curKey = seg.Key
+			}
+			if haveSeq && seg.SeqId <= lastSeq {
+				continue
+			}
+			pendingSegs = append(pendingSegs, seg)
+			pendingKeys = append(pendingKeys, curKey)
+		}
+
+		if len(pendingSegs) > 0 {
+			paths, err := downloadSegmentBatch(ctx, tmpDir, mediaURL, pendingSegs, pendingKeys, len(allPaths), concurrency)
+			if err != nil {
+				return nil, err
+			}
+			allPaths = append(allPaths, paths...)
+
+			lastSeq = pendingSegs[len(pendingSegs)-1].SeqId
+			haveSeq = true
+
+			for _, seg := range pendingSegs {
+				elapsed += time.Duration(seg.Duration * float64(time.Second))
+			}
+		}
+
+		if playlist.Closed {
+			break
+		}
+
+		if elapsed >= MaxHLSDuration {
+			gologging.WarnF("HLS: live playlist %s exceeded %s, stopping", trackID, MaxHLSDuration)
+			break
+		}
+
+		interval := hlsDefaultPollInterval
+		if playlist.TargetDuration > 0 {
+			interval = time.Duration(playlist.TargetDuration * float64(time.Second))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	return allPaths, nil
+}
+
+// downloadSegmentBatch fetches segs concurrently, bounded by concurrency,
+// and cancels the rest on the first error. Output file names are offset by
+// startIndex so successive polls of a live playlist don't collide.
+func downloadSegmentBatch(
+	ctx context.Context,
+	tmpDir, mediaURL string,
+	segs []*m3u8.MediaSegment,
+	keys []*m3u8.Key,
+	startIndex, concurrency int,
+) ([]string, error) {
+	paths := make([]string, len(segs))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for i := range segs {
+		i := i
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			path, err := downloadSegment(ctx, tmpDir, mediaURL, segs[i], keys[i], startIndex+i)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+				return
+			}
+
+			paths[i] = path
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return paths, nil
+}
+
+func downloadSegment(ctx context.Context, tmpDir, mediaURL string, seg *m3u8.MediaSegment, key *m3u8.Key, index int) (string, error) {
+	segURL := resolveURL(mediaURL, seg.URI)
+
+	body, err := fetchURL(ctx, segURL)
+	if err != nil {
+		return "", fmt.Errorf("segment %d: %w", index, err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("segment %d: %w", index, err)
+	}
+
+	if key != nil && key.Method == "AES-128" {
+		data, err = decryptSegment(ctx, mediaURL, key, seg.SeqId, data)
+		if err != nil {
+			return "", fmt.Errorf("segment %d: %w", index, err)
+		}
+	}
+
+	path := filepath.Join(tmpDir, fmt.Sprintf("seg-%05d.ts", index))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("segment %d: %w", index, err)
+	}
+
+	return path, nil
+}
+
+func decryptSegment(ctx context.Context, mediaURL string, key *m3u8.Key, seqID uint64, data []byte) ([]byte, error) {
+	keyBody, err := fetchURL(ctx, resolveURL(mediaURL, key.URI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch decryption key: %w", err)
+	}
+	defer keyBody.Close()
+
+	keyBytes, err := io.ReadAll(keyBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decryption key: %w", err)
+	}
+
+	block, err := aes.NewCipher(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AES-128 key: %w", err)
+	}
+
+	iv, err := resolveIV(key.IV, seqID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("segment is not a multiple of the AES block size")
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	return pkcs7Unpad(out), nil
+}
+
+// resolveIV decodes the EXT-X-KEY IV attribute (hex-encoded, optionally
+// "0x"-prefixed). Per RFC 8216 §5.2, when no IV attribute is present the
+// segment's media sequence number is used instead, big-endian, left-padded
+// with zeros to a full 16-byte block.
+func resolveIV(ivAttr string, seqID uint64) ([]byte, error) {
+	if ivAttr == "" {
+		iv := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], seqID)
+		return iv, nil
+	}
+
+	hexIV := strings.TrimPrefix(strings.TrimPrefix(ivAttr, "0x"), "0X")
+	iv, err := hex.DecodeString(hexIV)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IV %q: %w", ivAttr, err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("IV must be %d bytes, got %d", aes.BlockSize, len(iv))
+	}
+
+	return iv, nil
+}
+
+func pkcs7Unpad(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	padLen := int(data[len(data)-1])
+	if padLen <= 0 || padLen > len(data) {
+		return data
+	}
+	return data[:len(data)-padLen]
+}
+
+// concatSegments joins every segment file, in playlist order, into a single
+// .ts file ready for ffmpeg to remux.
+func concatSegments(outPath string, segmentPaths []string) error {
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for _, p := range segmentPaths {
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remux invokes ffmpeg to repackage concatPath into outPath without
+// re-encoding.
+func remux(ctx context.Context, concatPath, outPath string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-i", concatPath, "-c", "copy", outPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func fetchURL(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, url)
+	}
+
+	return resp.Body, nil
+}
+
+// resolveURL joins a (possibly relative) segment/variant URI against the
+// manifest URL it was referenced from.
+func resolveURL(base, ref string) string {
+	if strings.Contains(ref, "://") {
+		return ref
+	}
+
+	idx := strings.LastIndex(base, "/")
+	if idx == -1 {
+		return ref
+	}
+
+	return base[:idx+1] + ref
+}
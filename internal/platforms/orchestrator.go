@@ -0,0 +1,345 @@
+/*
+ * This file is part of YukkiMusic.
+ *
+ * YukkiMusic — A Telegram bot that streams music into group voice chats with seamless playback and control.
+ * Copyright (C) 2025 TheTeamVivek
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package platforms
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laky-64/gologging"
+	"github.com/amarnathcjd/gogram/telegram"
+
+	state "main/internal/core/models"
+)
+
+// errClass classifies a download failure so the orchestrator knows whether
+// to keep trying other platforms for the same track.
+type errClass int
+
+const (
+	// classRetryable failures are specific to the platform that produced
+	// them; the orchestrator moves on to the next one.
+	classRetryable errClass = iota
+	// classFatal failures mean the track itself can't be served by any
+	// platform (removed, age-restricted, region-blocked, ...), so the
+	// whole chain is aborted.
+	classFatal
+	// classThrottled failures count against the platform's circuit
+	// breaker in addition to being retryable.
+	classThrottled
+)
+
+// fatalSubstrings mirrors ytsync's "never retry" list: once one of these
+// shows up in an error message, no other platform is going to succeed
+// either.
+var fatalSubstrings = []string{
+	"video unavailable",
+	"private video",
+	"age-restricted",
+	"age restricted",
+	"sign in to confirm your age",
+	"region-blocked",
+	"not available in your country",
+	"copyright",
+	"removed by the uploader",
+	"account associated with this video has been terminated",
+	"video has been removed",
+}
+
+// throttledSubstrings flags provider rate limiting / quota exhaustion.
+var throttledSubstrings = []string{
+	"429",
+	"too many requests",
+	"quota",
+	"rate limit",
+	"403",
+}
+
+func classify(err error) errClass {
+	if err == nil {
+		return classRetryable
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	for _, s := range fatalSubstrings {
+		if strings.Contains(msg, s) {
+			return classFatal
+		}
+	}
+
+	for _, s := range throttledSubstrings {
+		if strings.Contains(msg, s) {
+			return classThrottled
+		}
+	}
+
+	return classRetryable
+}
+
+// Defaults used when the corresponding state.Config field is unset.
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitFailureWindow    = 60 * time.Second
+	defaultCircuitOpenDuration     = 5 * time.Minute
+)
+
+// circuitBreaker trips after failureThreshold throttled failures within
+// failureWindow, and stays open for openDuration. Thresholds are read from
+// state.Config once per breaker, the same way ValidateMedia reads
+// MinTrackDuration.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  []time.Time
+	openUntil time.Time
+
+	failureThreshold int
+	failureWindow    time.Duration
+	openDuration     time.Duration
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	threshold := defaultCircuitFailureThreshold
+	if state.Config.CircuitBreakerFailureThreshold > 0 {
+		threshold = state.Config.CircuitBreakerFailureThreshold
+	}
+
+	window := defaultCircuitFailureWindow
+	if state.Config.CircuitBreakerFailureWindow > 0 {
+		window = state.Config.CircuitBreakerFailureWindow
+	}
+
+	openDuration := defaultCircuitOpenDuration
+	if state.Config.CircuitBreakerOpenDuration > 0 {
+		openDuration = state.Config.CircuitBreakerOpenDuration
+	}
+
+	return &circuitBreaker{
+		failureThreshold: threshold,
+		failureWindow:    window,
+		openDuration:     openDuration,
+	}
+}
+
+func (c *circuitBreaker) recordFailure() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.failures = append(c.failures, now)
+
+	cutoff := now.Add(-c.failureWindow)
+	kept := c.failures[:0]
+	for _, t := range c.failures {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	c.failures = kept
+
+	if len(c.failures) >= c.failureThreshold {
+		c.openUntil = now.Add(c.openDuration)
+	}
+}
+
+func (c *circuitBreaker) open() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Before(c.openUntil)
+}
+
+// PlatformStats reports how a single platform has performed across every
+// Orchestrator.Download call since the orchestrator was created.
+type PlatformStats struct {
+	Successes   int
+	Failures    int
+	Latencies   []time.Duration
+	CircuitOpen bool
+}
+
+// Orchestrator drives the platform fallback chain: given a track and its
+// source platform, it walks every registered platform that supports
+// downloading from that source, in priority order, until one succeeds.
+type Orchestrator struct {
+	mu       sync.Mutex
+	breakers map[state.PlatformName]*circuitBreaker
+	stats    map[state.PlatformName]*PlatformStats
+}
+
+// NewOrchestrator builds an Orchestrator with a fresh set of circuit
+// breakers and stats counters.
+func NewOrchestrator() *Orchestrator {
+	return &Orchestrator{
+		breakers: make(map[state.PlatformName]*circuitBreaker),
+		stats:    make(map[state.PlatformName]*PlatformStats),
+	}
+}
+
+func (o *Orchestrator) breakerFor(name state.PlatformName) *circuitBreaker {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	b, ok := o.breakers[name]
+	if !ok {
+		b = newCircuitBreaker()
+		o.breakers[name] = b
+	}
+	return b
+}
+
+func (o *Orchestrator) record(name state.PlatformName, success bool, latency time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, ok := o.stats[name]
+	if !ok {
+		s = &PlatformStats{}
+		o.stats[name] = s
+	}
+
+	if success {
+		s.Successes++
+	} else {
+		s.Failures++
+	}
+	s.Latencies = append(s.Latencies, latency)
+}
+
+// Stats returns a snapshot of per-platform success/failure counts, observed
+// latencies, and current circuit state.
+func (o *Orchestrator) Stats() map[state.PlatformName]PlatformStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	out := make(map[state.PlatformName]PlatformStats, len(o.stats))
+	for name, s := range o.stats {
+		snapshot := *s
+		snapshot.Latencies = append([]time.Duration(nil), s.Latencies...)
+		if b, ok := o.breakers[name]; ok {
+			snapshot.CircuitOpen = b.open()
+		}
+		out[name] = snapshot
+	}
+	return out
+}
+
+type sourceContextKey struct{}
+
+// WithSource attaches the track's originating platform to ctx so a platform
+// whose Download supports more than one source (e.g. YtDlpPlatform) can
+// tell them apart without changing the shared Platform.Download signature.
+func WithSource(ctx context.Context, source state.PlatformName) context.Context {
+	return context.WithValue(ctx, sourceContextKey{}, source)
+}
+
+// SourceFromContext returns the originating platform attached by
+// WithSource, if any.
+func SourceFromContext(ctx context.Context) (state.PlatformName, bool) {
+	source, ok := ctx.Value(sourceContextKey{}).(state.PlatformName)
+	return source, ok
+}
+
+// Download tries every platform that supports downloading from source, in
+// priority order, returning the first successful local file path. Fatal
+// errors abort the chain immediately; throttled errors count toward that
+// platform's circuit breaker, and once it trips later calls skip the
+// platform until it cools down.
+func (o *Orchestrator) Download(
+	ctx context.Context,
+	track *state.Track,
+	source state.PlatformName,
+	msg *telegram.NewMessage,
+) (string, error) {
+	var lastErr error
+
+	for _, p := range Platforms() {
+		if !p.IsDownloadSupported(source) {
+			continue
+		}
+
+		name := p.Name()
+		breaker := o.breakerFor(name)
+		if breaker.open() {
+			gologging.InfoF("orchestrator: skipping %s, circuit open", name)
+			continue
+		}
+
+		start := time.Now()
+		path, err := p.Download(WithSource(ctx, source), track, msg)
+		latency := time.Since(start)
+
+		if err == nil {
+			o.record(name, true, latency)
+			return path, nil
+		}
+
+		o.record(name, false, latency)
+
+		switch classify(err) {
+		case classFatal:
+			gologging.ErrorF("orchestrator: %s reported a fatal error for %s: %v", name, track.Title, err)
+			return "", fmt.Errorf("%s: %w", name, err)
+		case classThrottled:
+			breaker.recordFailure()
+			gologging.WarnF("orchestrator: %s throttled: %v", name, err)
+		default:
+			gologging.WarnF("orchestrator: %s failed, trying next platform: %v", name, err)
+		}
+
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return "", fmt.Errorf("no platform supports downloading from %s", source)
+	}
+	return "", fmt.Errorf("all platforms failed: %w", lastErr)
+}
+
+var (
+	defaultOrchestratorOnce sync.Once
+	defaultOrchestratorInst *Orchestrator
+)
+
+// defaultOrchestrator lazily builds the package-wide Orchestrator so its
+// circuit breaker and stats state persist across calls, the same way
+// getSourceIPPool keeps one shared ippool.Pool alive.
+func defaultOrchestrator() *Orchestrator {
+	defaultOrchestratorOnce.Do(func() {
+		defaultOrchestratorInst = NewOrchestrator()
+	})
+	return defaultOrchestratorInst
+}
+
+// Download is the supported entry point for downloading a track: it runs
+// the platform fallback chain through the default Orchestrator instead of
+// calling a single platform directly. Callers that used to pick a platform
+// themselves and call its Download method should call this instead.
+func Download(
+	ctx context.Context,
+	track *state.Track,
+	source state.PlatformName,
+	msg *telegram.NewMessage,
+) (string, error) {
+	return defaultOrchestrator().Download(ctx, track, source, msg)
+}
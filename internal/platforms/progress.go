@@ -0,0 +1,207 @@
+/*
+ * This file is part of YukkiMusic.
+ *
+ * YukkiMusic — A Telegram bot that streams music into group voice chats with seamless playback and control.
+ * Copyright (C) 2025 TheTeamVivek
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package platforms
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laky-64/gologging"
+	"github.com/amarnathcjd/gogram/telegram"
+)
+
+const (
+	progressEditInterval = 2 * time.Second
+	progressBarWidth     = 20
+)
+
+// ProgressReporter is satisfied by anything that can be handed to
+// io.MultiWriter alongside the destination file and closed once the
+// download finishes.
+type ProgressReporter interface {
+	Write(p []byte) (int, error)
+	Close()
+}
+
+// TelegramProgress edits a Telegram message roughly every two seconds with
+// bytes downloaded out of the total, the transfer rate, and ETA (or just a
+// percentage, when built by NewTelegramPercentProgress), coalescing writes with a
+// ticker so it never trips Telegram's flood-wait. Modeled on ytsync's mpb
+// progress bars.
+type TelegramProgress struct {
+	msg         *telegram.NewMessage
+	title       string
+	total       int64
+	percentMode bool
+
+	downloaded atomic.Int64
+	start      time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTelegramProgress starts a background ticker that edits msg with
+// download progress for title. total is the expected size in bytes from the
+// response's Content-Length, or 0 if unknown.
+func NewTelegramProgress(msg *telegram.NewMessage, title string, total int64) *TelegramProgress {
+	return newTelegramProgress(msg, title, total, false)
+}
+
+// NewTelegramPercentProgress is for sources that only ever report a
+// percentage complete (e.g. yt-dlp's "[download] NN.N% of ..." lines)
+// rather than a real byte count. downloaded is tracked as whole percentage
+// points out of 100 instead of bytes, and the rendered message shows a
+// percentage instead of a byte rate and ETA.
+func NewTelegramPercentProgress(msg *telegram.NewMessage, title string) *TelegramProgress {
+	return newTelegramProgress(msg, title, 100, true)
+}
+
+func newTelegramProgress(msg *telegram.NewMessage, title string, total int64, percentMode bool) *TelegramProgress {
+	p := &TelegramProgress{
+		msg:         msg,
+		title:       title,
+		total:       total,
+		percentMode: percentMode,
+		start:       time.Now(),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go p.run()
+
+	return p
+}
+
+// Write satisfies io.Writer so a TelegramProgress can sit in an
+// io.MultiWriter alongside the destination file.
+func (p *TelegramProgress) Write(b []byte) (int, error) {
+	p.downloaded.Add(int64(len(b)))
+	return len(b), nil
+}
+
+func (p *TelegramProgress) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(progressEditInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.edit(false)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *TelegramProgress) edit(final bool) {
+	if p.msg == nil {
+		return
+	}
+
+	downloaded := p.downloaded.Load()
+	elapsed := time.Since(p.start)
+
+	var text string
+	switch {
+	case p.percentMode && final:
+		text = fmt.Sprintf("✓ Downloaded %s in %s", p.title, elapsed.Round(100*time.Millisecond))
+	case p.percentMode:
+		text = fmt.Sprintf("%s\n%s\n%d%%", p.title, progressBar(downloaded, p.total), downloaded)
+	case final:
+		text = fmt.Sprintf(
+			"✓ Downloaded %s in %s",
+			humanBytes(downloaded),
+			elapsed.Round(100*time.Millisecond),
+		)
+	default:
+		rate := float64(downloaded) / elapsed.Seconds()
+		text = fmt.Sprintf(
+			"%s\n%s\n%s / %s  •  %s/s%s",
+			p.title,
+			progressBar(downloaded, p.total),
+			humanBytes(downloaded),
+			totalLabel(p.total),
+			humanBytes(int64(rate)),
+			etaLabel(downloaded, p.total, rate),
+		)
+	}
+
+	if _, err := p.msg.Edit(text); err != nil {
+		gologging.WarnF("progress: failed to edit message: %v", err)
+	}
+}
+
+// Close stops the ticker and writes a final "done" edit.
+func (p *TelegramProgress) Close() {
+	close(p.stop)
+	<-p.done
+	p.edit(true)
+}
+
+func progressBar(downloaded, total int64) string {
+	if total <= 0 {
+		return strings.Repeat("░", progressBarWidth)
+	}
+
+	filled := int(float64(progressBarWidth) * float64(downloaded) / float64(total))
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+
+	return strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+}
+
+func totalLabel(total int64) string {
+	if total <= 0 {
+		return "?"
+	}
+	return humanBytes(total)
+}
+
+func etaLabel(downloaded, total int64, rate float64) string {
+	if total <= 0 || rate <= 0 || downloaded >= total {
+		return ""
+	}
+
+	remainingSeconds := float64(total-downloaded) / rate
+	remaining := time.Duration(remainingSeconds * float64(time.Second))
+	return fmt.Sprintf("  •  ETA %s", remaining.Round(time.Second))
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for remainder := n / unit; remainder >= unit; remainder /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
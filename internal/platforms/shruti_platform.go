@@ -25,6 +25,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -34,6 +35,7 @@ import (
 	"github.com/amarnathcjd/gogram/telegram"
 	"resty.dev/v3"
 
+	"main/internal/core/ippool"
 	state "main/internal/core/models"
 )
 
@@ -84,12 +86,18 @@ func (s *ShrutiAPIPlatform) IsDownloadSupported(
 func (s *ShrutiAPIPlatform) Download(
 	ctx context.Context,
 	track *state.Track,
-	_ *telegram.NewMessage,
+	msg *telegram.NewMessage,
 ) (string, error) {
-	// Check cache first
+	// Check cache first. A cached file that fails validation (e.g. a
+	// truncated download from before this check existed) is discarded so
+	// the rest of Download re-fetches it instead of serving it forever.
 	if path, err := checkDownloadedFile(track.ID); err == nil {
-		gologging.InfoF("ShrutiAPI: Using cached file for %s", track.ID)
-		return path, nil
+		if verr := ValidateMedia(path, track.Video, 0); verr == nil {
+			gologging.InfoF("ShrutiAPI: Using cached file for %s", track.ID)
+			return path, nil
+		} else {
+			gologging.WarnF("ShrutiAPI: cached file for %s failed validation, re-downloading: %v", track.ID, verr)
+		}
 	}
 
 	gologging.InfoF("ShrutiAPI: Downloading %s", track.Title)
@@ -116,15 +124,23 @@ func (s *ShrutiAPIPlatform) Download(
 
 	filePath := filepath.Join("downloads", track.ID+ext)
 
+	// Pull a source IP from the pool, if one is configured, to spread
+	// calls across interfaces and dodge per-IP rate limits. Falls back to
+	// default outbound behavior when the pool is disabled or exhausted.
+	sourceIP, releaseIP, ipErr := getSourceIPPool().Get(ctx)
+	if ipErr == nil {
+		defer releaseIP()
+	}
+
 	// Get download token
-	token, err := s.getDownloadToken(ctx, videoID, mediaType)
+	token, err := s.getDownloadToken(ctx, videoID, mediaType, sourceIP)
 	if err != nil {
 		gologging.ErrorF("ShrutiAPI: Failed to get download token: %v", err)
 		return "", fmt.Errorf("failed to get download token: %w", err)
 	}
 
 	// Download the file
-	if err := s.downloadFile(ctx, videoID, mediaType, token, filePath); err != nil {
+	if err := s.downloadFile(ctx, videoID, mediaType, token, filePath, sourceIP, msg, track.Title); err != nil {
 		os.Remove(filePath) // Clean up on error
 		gologging.ErrorF("ShrutiAPI: Download failed: %v", err)
 		return "", fmt.Errorf("download failed: %w", err)
@@ -136,19 +152,32 @@ func (s *ShrutiAPIPlatform) Download(
 		return "", errors.New("downloaded file is empty or missing")
 	}
 
+	// Reject truncated files, HTML error pages saved with a media
+	// extension, and silent stubs before handing the file back.
+	if err := ValidateMedia(filePath, track.Video, 0); err != nil {
+		gologging.ErrorF("ShrutiAPI: Downloaded file failed validation: %v", err)
+		return "", fmt.Errorf("downloaded file failed validation: %w", err)
+	}
+
 	gologging.InfoF("ShrutiAPI: Successfully downloaded %s", track.Title)
 	return filePath, nil
 }
 
-// getDownloadToken requests a download token from the API
+// getDownloadToken requests a download token from the API. When sourceIP is
+// non-nil the request is sent from that local interface.
 func (s *ShrutiAPIPlatform) getDownloadToken(
 	ctx context.Context,
 	videoID string,
 	mediaType string,
+	sourceIP *net.TCPAddr,
 ) (string, error) {
 	client := resty.New().
 		SetTimeout(7 * time.Second)
 
+	if transport := httpTransportForIP(sourceIP); transport != nil {
+		client.SetTransport(transport)
+	}
+
 	defer client.Close()
 
 	var result shrutiDownloadResponse
@@ -170,6 +199,10 @@ func (s *ShrutiAPIPlatform) getDownloadToken(
 		return "", fmt.Errorf("api request failed: %w", err)
 	}
 
+	if resp.StatusCode() == http.StatusTooManyRequests || resp.StatusCode() == http.StatusForbidden {
+		getSourceIPPool().ReportThrottle(sourceIP)
+	}
+
 	if resp.IsError() {
 		return "", fmt.Errorf("api returned status: %d", resp.StatusCode())
 	}
@@ -181,13 +214,17 @@ func (s *ShrutiAPIPlatform) getDownloadToken(
 	return result.DownloadToken, nil
 }
 
-// downloadFile downloads the actual media file
+// downloadFile downloads the actual media file. When sourceIP is non-nil the
+// client dials out from that local interface.
 func (s *ShrutiAPIPlatform) downloadFile(
 	ctx context.Context,
 	videoID string,
 	mediaType string,
 	token string,
 	filePath string,
+	sourceIP *net.TCPAddr,
+	msg *telegram.NewMessage,
+	title string,
 ) error {
 	streamURL := fmt.Sprintf(
 		"%s/stream/%s?type=%s&token=%s",
@@ -214,6 +251,9 @@ func (s *ShrutiAPIPlatform) downloadFile(
 			return nil
 		},
 	}
+	if transport := httpTransportForIP(sourceIP); transport != nil {
+		client.Transport = transport
+	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", streamURL, nil)
 	if err != nil {
@@ -230,6 +270,10 @@ func (s *ShrutiAPIPlatform) downloadFile(
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		getSourceIPPool().ReportThrottle(sourceIP)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
@@ -241,6 +285,13 @@ func (s *ShrutiAPIPlatform) downloadFile(
 	}
 	defer outFile.Close()
 
+	var dest io.Writer = outFile
+	if state.Config.EnableDownloadProgress && msg != nil {
+		progress := NewTelegramProgress(msg, title, resp.ContentLength)
+		defer progress.Close()
+		dest = io.MultiWriter(outFile, progress)
+	}
+
 	// Download with chunked reading
 	buf := make([]byte, 16384) // 16KB chunks
 	for {
@@ -253,7 +304,7 @@ func (s *ShrutiAPIPlatform) downloadFile(
 
 		n, err := resp.Body.Read(buf)
 		if n > 0 {
-			if _, writeErr := outFile.Write(buf[:n]); writeErr != nil {
+			if _, writeErr := dest.Write(buf[:n]); writeErr != nil {
 				return fmt.Errorf("write error: %w", writeErr)
 			}
 		}
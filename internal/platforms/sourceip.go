@@ -0,0 +1,57 @@
+/*
+ * This file is part of YukkiMusic.
+ *
+ * YukkiMusic — A Telegram bot that streams music into group voice chats with seamless playback and control.
+ * Copyright (C) 2025 TheTeamVivek
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package platforms
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"main/internal/core/ippool"
+	state "main/internal/core/models"
+)
+
+var (
+	sourceIPPoolOnce sync.Once
+	sourceIPPool     *ippool.Pool
+)
+
+// getSourceIPPool lazily builds the shared ippool.Pool from
+// state.Config.DownloadSourceIPs. Platforms should use this instead of
+// constructing their own pool so cooldowns and throttle state are shared.
+func getSourceIPPool() *ippool.Pool {
+	sourceIPPoolOnce.Do(func() {
+		sourceIPPool = ippool.New(state.Config.DownloadSourceIPs, 0, 0)
+	})
+	return sourceIPPool
+}
+
+// httpTransportForIP returns an *http.Transport whose dialer binds to
+// localAddr, or nil when localAddr is nil (the transport's zero value is
+// then left to http.DefaultTransport's usual defaults by the caller).
+func httpTransportForIP(localAddr *net.TCPAddr) *http.Transport {
+	if localAddr == nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{LocalAddr: localAddr}
+	return &http.Transport{DialContext: dialer.DialContext}
+}
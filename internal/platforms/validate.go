@@ -0,0 +1,131 @@
+/*
+ * This file is part of YukkiMusic.
+ *
+ * YukkiMusic — A Telegram bot that streams music into group voice chats with seamless playback and control.
+ * Copyright (C) 2025 TheTeamVivek
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package platforms
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ffprobe "gopkg.in/vansante/go-ffprobe.v2"
+
+	state "main/internal/core/models"
+)
+
+// DefaultMinTrackDuration is used when state.Config.MinTrackDuration is unset.
+const DefaultMinTrackDuration = 10 * time.Second
+
+// ValidateMedia runs ffprobe over the file at path and rejects truncated
+// downloads, HTML error pages saved with a media extension, and silent
+// stubs. It deletes path on failure so the caller's fallback chain can try
+// the next platform with a clean slate.
+func ValidateMedia(path string, wantVideo bool, minDuration time.Duration) error {
+	if err := validateMedia(path, wantVideo, minDuration); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+func validateMedia(path string, wantVideo bool, minDuration time.Duration) error {
+	if minDuration <= 0 {
+		minDuration = minTrackDuration()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	data, err := ffprobe.ProbeURL(ctx, path)
+	if err != nil {
+		return fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	if data.FirstAudioStream() == nil {
+		return fmt.Errorf("no audio stream found in %s", path)
+	}
+
+	if wantVideo && data.FirstVideoStream() == nil {
+		return fmt.Errorf("no video stream found in %s", path)
+	}
+
+	duration, err := formatDuration(data.Format.DurationSeconds)
+	if err != nil {
+		return fmt.Errorf("could not read duration: %w", err)
+	}
+	if duration < minDuration {
+		return fmt.Errorf("media duration %s is below the %s minimum", duration, minDuration)
+	}
+
+	if !containerMatchesExt(data.Format.FormatName, filepath.Ext(path)) {
+		return fmt.Errorf("container %q does not match extension %q", data.Format.FormatName, filepath.Ext(path))
+	}
+
+	return nil
+}
+
+func formatDuration(seconds float64) (time.Duration, error) {
+	if seconds <= 0 {
+		return 0, fmt.Errorf("invalid duration %v", seconds)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// containerMatchesExt checks ffprobe's comma-separated format_name (e.g.
+// "mp3" or "mov,mp4,m4a,3gp,3g2,mj2") against the file's extension.
+func containerMatchesExt(formatName, ext string) bool {
+	ext = strings.TrimPrefix(strings.ToLower(ext), ".")
+	if ext == "" {
+		return true
+	}
+
+	aliases := map[string][]string{
+		"mp3":  {"mp3"},
+		"mp4":  {"mp4", "mov", "m4a", "m4v", "3gp", "3g2", "mj2"},
+		"m4a":  {"mp4", "mov", "m4a", "m4v", "3gp", "3g2", "mj2"},
+		"webm": {"webm", "matroska"},
+		"mkv":  {"webm", "matroska"},
+		"ogg":  {"ogg"},
+	}
+
+	want, ok := aliases[ext]
+	if !ok {
+		want = []string{ext}
+	}
+
+	for _, format := range strings.Split(formatName, ",") {
+		for _, w := range want {
+			if format == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func minTrackDuration() time.Duration {
+	if state.Config.MinTrackDuration > 0 {
+		return state.Config.MinTrackDuration
+	}
+	return DefaultMinTrackDuration
+}
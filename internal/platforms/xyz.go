@@ -1,82 +1,123 @@
 package platforms
 
 import (
-        "context"
-        "errors"
-        "fmt"
-        "io"
-        "net/http"
-        "os"
-
-        "github.com/amarnathcjd/gogram/telegram"
-                        "github.com/TheTeamVivek/YukkiMusic/internal/state"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/Laky-64/gologging"
+	"github.com/amarnathcjd/gogram/telegram"
+
+	state "main/internal/core/models"
 )
 
 var (
-        apiBase = "https://youtubify.me"
-        apiKey  = os.Getenv("YT_API_KEY")
+	apiBase = "https://youtubify.me"
+	apiKey  = os.Getenv("YT_API_KEY")
 )
+
 const PlatformYoutubify state.PlatformName = "xyz"
+
 type YoutubifyPlatform struct{}
 
 func init() {
-        addPlatform(100, PlatformYoutubify, &YoutubifyPlatform{})
+	addPlatform(100, PlatformYoutubify, &YoutubifyPlatform{})
 }
 
 func (*YoutubifyPlatform) Name() state.PlatformName {
-        return PlatformYoutubify
+	return PlatformYoutubify
 }
 
 func (*YoutubifyPlatform) IsValid(query string) bool {
-        return false
+	return false
 }
 
 func (*YoutubifyPlatform) GetTracks(query string) ([]*state.Track, error) {
-        return nil, errors.New("Youtubify is a direct download platform")
+	return nil, errors.New("Youtubify is a direct download platform")
 }
 
 func (*YoutubifyPlatform) IsDownloadSupported(source state.PlatformName) bool {
-        return source == state.PlatformYouTube
+	return source == state.PlatformYouTube
 }
 
-func (f *YoutubifyPlatform) Download(_ context.Context, track *state.Track, _ *telegram.NewMessage) (string, error) {
-        return downloadAudio(track.ID)
+func (f *YoutubifyPlatform) Download(ctx context.Context, track *state.Track, msg *telegram.NewMessage) (string, error) {
+	return downloadAudio(ctx, track.ID, track.Video, track.Title, msg)
 }
 
-func downloadAudio(videoID string) (string, error) {
-        filepath := fmt.Sprintf("downloads/%s.mp3", videoID)
-
-        if _, err := os.Stat(filepath); err == nil {
-                return filepath, nil
-        }
-
-        if err := os.MkdirAll("downloads", 0755); err != nil {
-                return "", err
-        }
-
-        client := &http.Client{}
-        url := fmt.Sprintf("%s/download/audio?video_id=%s&mode=download&no_redirect=1&api_key=%s", apiBase, videoID, apiKey)
-
-        resp, err := client.Get(url)
-        if err != nil {
-                return "", err
-        }
-        defer resp.Body.Close()
-
-        if resp.StatusCode != 200 {
-                return "", fmt.Errorf("API returned %s", resp.Status)
-        }
-
-        out, err := os.Create(filepath)
-        if err != nil {
-                return "", err
-        }
-        defer out.Close()
-
-        _, err = io.Copy(out, resp.Body)
-        if err != nil {
-                return "", err
-        }
-
-        return filepath, nil
+func downloadAudio(ctx context.Context, videoID string, wantVideo bool, title string, msg *telegram.NewMessage) (string, error) {
+	filepath := fmt.Sprintf("downloads/%s.mp3", videoID)
+
+	// A cached file that fails validation (e.g. a truncated download from
+	// before this check existed) is discarded so it's re-fetched below
+	// instead of being served forever.
+	if _, err := os.Stat(filepath); err == nil {
+		if verr := ValidateMedia(filepath, wantVideo, 0); verr == nil {
+			return filepath, nil
+		} else {
+			gologging.WarnF("Youtubify: cached file for %s failed validation, re-downloading: %v", videoID, verr)
+		}
+	}
+
+	if err := os.MkdirAll("downloads", 0755); err != nil {
+		return "", err
+	}
+
+	// Pull a source IP from the pool, if one is configured, so repeated
+	// calls don't get rate-limited from a single address.
+	sourceIP, releaseIP, ipErr := getSourceIPPool().Get(ctx)
+	if ipErr == nil {
+		defer releaseIP()
+	}
+
+	client := &http.Client{}
+	if transport := httpTransportForIP(sourceIP); transport != nil {
+		client.Transport = transport
+	}
+	url := fmt.Sprintf("%s/download/audio?video_id=%s&mode=download&no_redirect=1&api_key=%s", apiBase, videoID, apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		getSourceIPPool().ReportThrottle(sourceIP)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API returned %s", resp.Status)
+	}
+
+	out, err := os.Create(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	var dest io.Writer = out
+	if state.Config.EnableDownloadProgress && msg != nil {
+		progress := NewTelegramProgress(msg, title, resp.ContentLength)
+		defer progress.Close()
+		dest = io.MultiWriter(out, progress)
+	}
+
+	_, err = io.Copy(dest, resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ValidateMedia(filepath, wantVideo, 0); err != nil {
+		return "", fmt.Errorf("downloaded file failed validation: %w", err)
+	}
+
+	return filepath, nil
 }
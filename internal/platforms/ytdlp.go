@@ -0,0 +1,279 @@
+/*
+ * This file is part of YukkiMusic.
+ *
+ * YukkiMusic — A Telegram bot that streams music into group voice chats with seamless playback and control.
+ * Copyright (C) 2025 TheTeamVivek
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package platforms
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Laky-64/gologging"
+	"github.com/amarnathcjd/gogram/telegram"
+
+	state "main/internal/core/models"
+)
+
+const PlatformYtDlp state.PlatformName = "YtDlp"
+
+// ytDlpKillGrace is how long SIGTERM gets to land before we escalate to
+// SIGKILL on context cancellation.
+const ytDlpKillGrace = 5 * time.Second
+
+var ytDlpProgressRe = regexp.MustCompile(`\[download\]\s+([\d.]+)% of`)
+
+// YtDlpPlatform shells out to a locally installed yt-dlp binary. It's the
+// last-resort fallback for when every HTTP-API-backed platform is down or
+// rate-limited, since yt-dlp extracts directly from the source instead of
+// depending on a third party.
+type YtDlpPlatform struct {
+	pathOnce sync.Once
+	path     string
+	pathErr  error
+}
+
+func init() {
+	// Priority 50 - below DirectStream (65), last resort. The binary is
+	// resolved lazily on first Download, not here, since state.Config
+	// (YtDlpBinaryPath included) isn't guaranteed to be populated yet at
+	// package init time.
+	Register(50, &YtDlpPlatform{})
+}
+
+// resolvedPath resolves and caches the yt-dlp binary path on first use. If
+// it isn't found on PATH, every subsequent Download call fails fast with
+// the same error instead of retrying the lookup.
+func (y *YtDlpPlatform) resolvedPath() (string, error) {
+	y.pathOnce.Do(func() {
+		bin := "yt-dlp"
+		if state.Config.YtDlpBinaryPath != "" {
+			bin = state.Config.YtDlpBinaryPath
+		}
+
+		y.path, y.pathErr = exec.LookPath(bin)
+		if y.pathErr != nil {
+			gologging.WarnF("YtDlp: binary not found on PATH, platform disabled: %v", y.pathErr)
+		}
+	})
+
+	return y.path, y.pathErr
+}
+
+func (y *YtDlpPlatform) Name() state.PlatformName {
+	return PlatformYtDlp
+}
+
+// IsValid - yt-dlp is download-only, doesn't resolve search queries itself.
+func (y *YtDlpPlatform) IsValid(query string) bool {
+	return false
+}
+
+// GetTracks - yt-dlp is a download-only platform.
+func (y *YtDlpPlatform) GetTracks(query string) ([]*state.Track, error) {
+	return nil, errors.New("yt-dlp is a download-only platform")
+}
+
+// IsDownloadSupported - reports true for YouTube and SoundCloud sources
+// only; other sources are rejected, and sourceURL only builds URLs for
+// those two.
+func (y *YtDlpPlatform) IsDownloadSupported(source state.PlatformName) bool {
+	switch source {
+	case state.PlatformYouTube, state.PlatformSoundCloud:
+		return true
+	default:
+		return false
+	}
+}
+
+// Download runs yt-dlp against track.ID's source URL, streaming its output
+// into gologging at debug level and reporting progress if msg is set and
+// state.Config.EnableDownloadProgress is on.
+func (y *YtDlpPlatform) Download(
+	ctx context.Context,
+	track *state.Track,
+	msg *telegram.NewMessage,
+) (string, error) {
+	// A cached file that fails validation (e.g. a truncated download from
+	// before this check existed) is discarded so the rest of Download
+	// re-fetches it instead of serving it forever.
+	if path, err := checkDownloadedFile(track.ID); err == nil {
+		if verr := ValidateMedia(path, track.Video, 0); verr == nil {
+			gologging.InfoF("YtDlp: Using cached file for %s", track.ID)
+			return path, nil
+		} else {
+			gologging.WarnF("YtDlp: cached file for %s failed validation, re-downloading: %v", track.ID, verr)
+		}
+	}
+
+	binaryPath, err := y.resolvedPath()
+	if err != nil {
+		return "", fmt.Errorf("yt-dlp binary unavailable: %w", err)
+	}
+
+	if err := ensureDownloadsDir(); err != nil {
+		return "", fmt.Errorf("failed to create downloads directory: %w", err)
+	}
+
+	outputTemplate := filepath.Join("downloads", "%(id)s.%(ext)s")
+
+	args := []string{"--no-playlist", "-o", outputTemplate}
+
+	if state.Config.YtDlpCookiesFile != "" {
+		args = append(args, "--cookies", state.Config.YtDlpCookiesFile)
+	}
+
+	if track.Video {
+		args = append(args, "-f", "best[height<=720]")
+	} else {
+		args = append(args, "-f", "bestaudio", "-x", "--audio-format", "mp3")
+	}
+
+	args = append(args, state.Config.YtDlpExtraArgs...)
+	args = append(args, sourceURL(ctx, track))
+
+	cmd := exec.CommandContext(ctx, binaryPath, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = ytDlpKillGrace
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to open stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to open stderr pipe: %w", err)
+	}
+
+	var progress ProgressReporter
+	if state.Config.EnableDownloadProgress && msg != nil {
+		progress = NewTelegramPercentProgress(msg, track.Title)
+		defer progress.Close()
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start yt-dlp: %w", err)
+	}
+
+	// os/exec requires every read from these pipes to finish before Wait
+	// is called - Wait closes them as soon as the process exits, which
+	// would otherwise race the still-reading goroutines.
+	var outputWg sync.WaitGroup
+	outputWg.Add(2)
+	go func() {
+		defer outputWg.Done()
+		streamYtDlpOutput(stdout, progress)
+	}()
+	go func() {
+		defer outputWg.Done()
+		streamYtDlpOutput(stderr, nil)
+	}()
+	outputWg.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		return "", fmt.Errorf("yt-dlp exited with error: %w", err)
+	}
+
+	ext := ".mp3"
+	if track.Video {
+		ext = ".mp4"
+	}
+	filePath := filepath.Join("downloads", track.ID+ext)
+
+	if stat, err := os.Stat(filePath); err != nil || stat.Size() == 0 {
+		os.Remove(filePath)
+		return "", errors.New("yt-dlp reported success but output file is missing or empty")
+	}
+
+	if err := ValidateMedia(filePath, track.Video, 0); err != nil {
+		return "", fmt.Errorf("downloaded file failed validation: %w", err)
+	}
+
+	gologging.InfoF("YtDlp: Successfully downloaded %s", track.Title)
+	return filePath, nil
+}
+
+// sourceURL builds the URL to hand yt-dlp, based on the originating
+// platform the Orchestrator attached to ctx (see WithSource). Falls back to
+// treating track.ID as a YouTube video ID when no source is attached, e.g.
+// when YtDlpPlatform.Download is invoked directly rather than through the
+// orchestrator.
+func sourceURL(ctx context.Context, track *state.Track) string {
+	source, _ := SourceFromContext(ctx)
+
+	switch source {
+	case state.PlatformSoundCloud:
+		if strings.Contains(track.ID, "://") {
+			return track.ID
+		}
+		return "https://soundcloud.com/" + track.ID
+	default:
+		return "https://www.youtube.com/watch?v=" + track.ID
+	}
+}
+
+// streamYtDlpOutput forwards yt-dlp's line-buffered output to gologging at
+// debug level and, when progress is non-nil, parses "[download] NN.N% of"
+// lines into whole percentage points written. progress is expected to be a
+// NewTelegramPercentProgress (total=100), since yt-dlp only ever reports a
+// percentage, not a real byte count.
+func streamYtDlpOutput(r io.Reader, progress ProgressReporter) {
+	scanner := bufio.NewScanner(r)
+	var lastWhole int
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		gologging.DebugF("yt-dlp: %s", line)
+
+		if progress == nil {
+			continue
+		}
+
+		match := ytDlpProgressRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		percent, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+
+		// Feed the delta in whole percentage points; NewTelegramPercentProgress's
+		// total of 100 makes this line up with its progress math.
+		whole := int(percent)
+		if delta := whole - lastWhole; delta > 0 {
+			lastWhole = whole
+			progress.Write(make([]byte, delta))
+		}
+	}
+}